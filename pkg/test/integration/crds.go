@@ -0,0 +1,183 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+	syaml "sigs.k8s.io/yaml"
+)
+
+const (
+	errReadCRDDir   = "cannot list CRD directory"
+	errReadCRDFile  = "cannot read CRD file"
+	errDecodeCRD    = "cannot decode CRD manifest"
+	errConvertCRD   = "cannot convert v1beta1 CRD to v1"
+	errRenderCRDDir = "cannot create rendered CRD directory"
+	errRenderCRD    = "cannot render CRD manifest"
+)
+
+// crdScheme knows how to decode both apiextensions/v1 and the legacy
+// apiextensions/v1beta1 CustomResourceDefinition, so that readCRDs can
+// transparently convert the latter.
+var crdScheme = runtime.NewScheme()
+
+func init() {
+	if err := apiextensionsv1.AddToScheme(crdScheme); err != nil {
+		panic(err)
+	}
+	if err := apiextensionsv1beta1.AddToScheme(crdScheme); err != nil {
+		panic(err)
+	}
+}
+
+// readCRDs reads every CustomResourceDefinition manifest in the supplied
+// directory and returns it as apiextensions/v1, transparently converting any
+// apiextensions/v1beta1 manifests (which Kubernetes 1.22+ no longer serves)
+// on the fly.
+func readCRDs(path string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, errReadCRDDir)
+	}
+
+	var crds []*apiextensionsv1.CustomResourceDefinition
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		f, err := os.Open(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, errReadCRDFile)
+		}
+
+		got, err := decodeCRDFile(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		crds = append(crds, got...)
+	}
+
+	return crds, nil
+}
+
+// decodeCRDFile decodes every document in a (possibly multi-document) YAML
+// file into an apiextensions/v1 CustomResourceDefinition.
+func decodeCRDFile(r io.Reader) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	var crds []*apiextensionsv1.CustomResourceDefinition
+
+	codecs := serializer.NewCodecFactory(crdScheme)
+	d := kyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		raw := runtime.RawExtension{}
+		if err := d.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, errors.Wrap(err, errDecodeCRD)
+		}
+		if len(raw.Raw) == 0 {
+			continue
+		}
+
+		obj, _, err := codecs.UniversalDeserializer().Decode(raw.Raw, nil, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, errDecodeCRD)
+		}
+
+		switch crd := obj.(type) {
+		case *apiextensionsv1.CustomResourceDefinition:
+			crds = append(crds, crd)
+		case *apiextensionsv1beta1.CustomResourceDefinition:
+			v1crd, err := convertV1beta1CRD(crd)
+			if err != nil {
+				return nil, errors.Wrap(err, errConvertCRD)
+			}
+			crds = append(crds, v1crd)
+		default:
+			return nil, errors.Errorf("unsupported CustomResourceDefinition type %T", obj)
+		}
+	}
+
+	return crds, nil
+}
+
+// convertV1beta1CRD converts a v1beta1 CustomResourceDefinition to v1 using
+// the generated apiextensions-apiserver conversion functions, routing
+// through the internal (hub) type the same way apiextensions-apiserver
+// itself does. This is what moves the top-level Validation.OpenAPIV3Schema,
+// Subresources and AdditionalPrinterColumns onto each entry in Versions, as
+// required by the v1 API.
+func convertV1beta1CRD(in *apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
+	internal := &apiextensions.CustomResourceDefinition{}
+	if err := apiextensionsv1beta1.Convert_v1beta1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(in, internal, nil); err != nil {
+		return nil, err
+	}
+
+	out := &apiextensionsv1.CustomResourceDefinition{}
+	if err := apiextensionsv1.Convert_apiextensions_CustomResourceDefinition_To_v1_CustomResourceDefinition(internal, out, nil); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// renderCRDs writes the supplied CRDs to a fresh temporary directory, one
+// manifest per file, so that a filtered or transformed set of CRDs can be
+// handed to envtest.Environment the same way a CRDDirectoryPaths entry
+// would be.
+func renderCRDs(crds []*apiextensionsv1.CustomResourceDefinition) (string, error) {
+	dir, err := ioutil.TempDir("", "integration-crds-")
+	if err != nil {
+		return "", errors.Wrap(err, errRenderCRDDir)
+	}
+
+	for i, crd := range crds {
+		crd.TypeMeta = metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		}
+
+		b, err := syaml.Marshal(crd)
+		if err != nil {
+			return "", errors.Wrap(err, errRenderCRD)
+		}
+
+		name := fmt.Sprintf("%03d-%s.yaml", i, crd.Name)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), b, 0o600); err != nil {
+			return "", errors.Wrap(err, errRenderCRD)
+		}
+	}
+
+	return dir, nil
+}
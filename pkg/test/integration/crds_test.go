@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"reflect"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConvertV1beta1CRD(t *testing.T) {
+	schema := &apiextensionsv1beta1.JSONSchemaProps{Type: "object"}
+
+	cases := map[string]struct {
+		in   *apiextensionsv1beta1.CustomResourceDefinition
+		want *apiextensionsv1.CustomResourceDefinition
+	}{
+		"TopLevelSchemaAndSubresourcesPushedToVersion": {
+			in: &apiextensionsv1beta1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.org"},
+				Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+					Group: "example.org",
+					Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+						Plural: "widgets",
+						Kind:   "Widget",
+					},
+					Scope:      apiextensionsv1beta1.NamespaceScoped,
+					Validation: &apiextensionsv1beta1.CustomResourceValidation{OpenAPIV3Schema: schema},
+					Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+						{Name: "v1alpha1", Served: true, Storage: true},
+					},
+					Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
+						Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+					},
+				},
+			},
+			want: &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.org"},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Group: "example.org",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{
+						Plural: "widgets",
+						Kind:   "Widget",
+					},
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+						{
+							Name:    "v1alpha1",
+							Served:  true,
+							Storage: true,
+							Schema: &apiextensionsv1.CustomResourceValidation{
+								OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+							},
+							Subresources: &apiextensionsv1.CustomResourceSubresources{
+								Status: &apiextensionsv1.CustomResourceSubresourceStatus{},
+							},
+						},
+					},
+				},
+			},
+		},
+		"PerVersionSchemaIsLeftAlone": {
+			in: &apiextensionsv1beta1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.org"},
+				Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+					Group: "example.org",
+					Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+						Plural: "widgets",
+						Kind:   "Widget",
+					},
+					Scope: apiextensionsv1beta1.NamespaceScoped,
+					Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+						{
+							Name:    "v1",
+							Served:  true,
+							Storage: true,
+							Schema:  &apiextensionsv1beta1.CustomResourceValidation{OpenAPIV3Schema: schema},
+						},
+					},
+				},
+			},
+			want: &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "widgets.example.org"},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Group: "example.org",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{
+						Plural: "widgets",
+						Kind:   "Widget",
+					},
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+						{
+							Name:    "v1",
+							Served:  true,
+							Storage: true,
+							Schema: &apiextensionsv1.CustomResourceValidation{
+								OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, err := convertV1beta1CRD(tc.in)
+			if err != nil {
+				t.Fatalf("convertV1beta1CRD(...): unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(tc.want.Spec, got.Spec) {
+				t.Errorf("convertV1beta1CRD(...): -want, +got:\n-%+v\n+%+v", tc.want.Spec, got.Spec)
+			}
+			if tc.want.Name != got.Name {
+				t.Errorf("convertV1beta1CRD(...): want name %q, got %q", tc.want.Name, got.Name)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultCRDEstablishPollInterval = 100 * time.Millisecond
+	defaultCRDEstablishTimeout      = 30 * time.Second
+)
+
+// A CRDEstablishmentError is returned by New when one or more
+// CustomResourceDefinitions do not report the Established condition before
+// the configured timeout elapses.
+type CRDEstablishmentError struct {
+	Pending []string
+}
+
+func (e *CRDEstablishmentError) Error() string {
+	return fmt.Sprintf("timed out waiting for CRDs to be established: %s", strings.Join(e.Pending, ", "))
+}
+
+// waitForCRDEstablishment blocks until every supplied CRD reports the
+// Established condition, polling at the supplied interval, or returns a
+// *CRDEstablishmentError if timeout elapses first.
+func waitForCRDEstablishment(cs clientset.Interface, crds []*apiextensionsv1.CustomResourceDefinition, pollInterval, timeout time.Duration) error {
+	pending := make(map[string]bool, len(crds))
+	for _, crd := range crds {
+		pending[crd.Name] = true
+	}
+
+	err := wait.PollImmediate(pollInterval, timeout, func() (bool, error) {
+		for name := range pending {
+			got, err := cs.ApiextensionsV1().CustomResourceDefinitions().Get(context.Background(), name, metav1.GetOptions{})
+			if err != nil {
+				// A freshly started control plane can return transient
+				// errors (e.g. while discovery catches up). Retry until
+				// timeout rather than failing New outright.
+				continue
+			}
+			if crdEstablished(got) {
+				delete(pending, name)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	return &CRDEstablishmentError{Pending: names}
+}
+
+func crdEstablished(crd *apiextensionsv1.CustomResourceDefinition) bool {
+	for _, cond := range crd.Status.Conditions {
+		if cond.Type == apiextensionsv1.Established && cond.Status == apiextensionsv1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const errRunFeatures = "one or more features failed"
+
+// A StepFn is a single Setup, Assess or Teardown step of a Feature.
+type StepFn func(ctx context.Context, e *envtest.Environment, c client.Client) error
+
+// A Feature is a named, declarative set of Setup, Assess and Teardown steps
+// run in order by Manager.RunFeatures, inspired by the e2e-framework's
+// setup/assess/teardown model.
+type Feature struct {
+	Name     string
+	Setup    []StepFn
+	Assess   []StepFn
+	Teardown []StepFn
+
+	// Timeout, if non-zero, bounds the whole Feature.
+	Timeout time.Duration
+
+	// StepTimeout, if non-zero, bounds each individual step.
+	StepTimeout time.Duration
+
+	namespacePrefix string
+}
+
+// A FeatureOption configures a Feature.
+type FeatureOption func(*Feature)
+
+// WithNamespace configures a Feature to create a uniquely named namespace
+// (generated from the supplied prefix) before running its Setup steps, and
+// injects its name into the context passed to every subsequent step. Use
+// NamespaceFromContext to retrieve it.
+func WithNamespace(prefix string) FeatureOption {
+	return func(f *Feature) {
+		f.namespacePrefix = prefix
+	}
+}
+
+// WithTimeout bounds the total time a Feature's steps are allowed to run.
+func WithTimeout(d time.Duration) FeatureOption {
+	return func(f *Feature) {
+		f.Timeout = d
+	}
+}
+
+// WithStepTimeout bounds the time each individual step of a Feature is
+// allowed to run.
+func WithStepTimeout(d time.Duration) FeatureOption {
+	return func(f *Feature) {
+		f.StepTimeout = d
+	}
+}
+
+// NewFeature returns a new named Feature with the supplied options applied.
+// Its Setup, Assess and Teardown steps are configured by setting those
+// fields directly.
+func NewFeature(name string, o ...FeatureOption) *Feature {
+	f := &Feature{Name: name}
+	for _, op := range o {
+		op(f)
+	}
+	return f
+}
+
+type namespaceContextKey struct{}
+
+// NamespaceFromContext returns the namespace injected into ctx by a Feature
+// configured with WithNamespace, if any.
+func NamespaceFromContext(ctx context.Context) (string, bool) {
+	ns, ok := ctx.Value(namespaceContextKey{}).(string)
+	return ns, ok
+}
+
+// A StepResult is the outcome of running a single step of a Feature.
+type StepResult struct {
+	Stage string `json:"stage"`
+	Error string `json:"error,omitempty"`
+}
+
+// A FeatureReport is a machine-readable record of the outcome of running a
+// Feature.
+type FeatureReport struct {
+	Feature string       `json:"feature"`
+	Passed  bool         `json:"passed"`
+	Steps   []StepResult `json:"steps"`
+}
+
+// ReportJSON marshals a set of FeatureReports to indented JSON.
+func ReportJSON(reports []FeatureReport) ([]byte, error) {
+	return json.MarshalIndent(reports, "", "  ")
+}
+
+// RunFeatures executes the supplied Features in order, running each one's
+// Setup, Assess and Teardown steps in turn. A Feature configured with
+// WithNamespace that fails to create its namespace is recorded as a Setup
+// failure rather than aborting the run. Assess steps are skipped if any
+// Setup step (including namespace creation) fails, but Teardown steps
+// always run. It returns a FeatureReport per Feature, and a non-nil error if
+// any Feature failed.
+func (m *Manager) RunFeatures(ctx context.Context, features ...Feature) ([]FeatureReport, error) {
+	reports := make([]FeatureReport, 0, len(features))
+	failed := false
+
+	for i := range features {
+		f := features[i]
+
+		fctx := ctx
+		if f.Timeout > 0 {
+			var cancel context.CancelFunc
+			fctx, cancel = context.WithTimeout(ctx, f.Timeout)
+			defer cancel()
+		}
+
+		report := FeatureReport{Feature: f.Name, Passed: true}
+		setupOK := true
+
+		if f.namespacePrefix != "" {
+			ns, err := m.createFeatureNamespace(fctx, f.namespacePrefix)
+			if err != nil {
+				report.Steps = append(report.Steps, newStepResult("Setup", errors.Wrapf(err, "cannot create namespace for feature %q", f.Name)))
+				report.Passed = false
+				setupOK = false
+			} else {
+				fctx = context.WithValue(fctx, namespaceContextKey{}, ns)
+			}
+		}
+
+		if setupOK {
+			for _, step := range f.Setup {
+				err := m.runStep(fctx, step, f.StepTimeout)
+				report.Steps = append(report.Steps, newStepResult("Setup", err))
+				if err != nil {
+					report.Passed = false
+					setupOK = false
+				}
+			}
+		}
+
+		if setupOK {
+			for _, step := range f.Assess {
+				err := m.runStep(fctx, step, f.StepTimeout)
+				report.Steps = append(report.Steps, newStepResult("Assess", err))
+				if err != nil {
+					report.Passed = false
+				}
+			}
+		}
+
+		for _, step := range f.Teardown {
+			err := m.runStep(fctx, step, f.StepTimeout)
+			report.Steps = append(report.Steps, newStepResult("Teardown", err))
+			if err != nil {
+				report.Passed = false
+			}
+		}
+
+		failed = failed || !report.Passed
+		reports = append(reports, report)
+	}
+
+	if failed {
+		return reports, errors.New(errRunFeatures)
+	}
+	return reports, nil
+}
+
+func (m *Manager) runStep(ctx context.Context, step StepFn, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return step(ctx, m.env, m.client)
+}
+
+func newStepResult(stage string, err error) StepResult {
+	r := StepResult{Stage: stage}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+func (m *Manager) createFeatureNamespace(ctx context.Context, prefix string) (string, error) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: prefix + "-"}}
+	if err := m.client.Create(ctx, ns); err != nil {
+		return "", err
+	}
+	return ns.GetName(), nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+func newTestManager() *Manager {
+	s := runtime.NewScheme()
+	_ = corev1.AddToScheme(s)
+
+	return &Manager{
+		env:    &envtest.Environment{},
+		client: fake.NewClientBuilder().WithScheme(s).Build(),
+	}
+}
+
+// namespaceCreateFailingClient wraps a client.Client to make every attempt
+// to create a Namespace fail, so that createFeatureNamespace's error path
+// can be exercised without a real API server.
+type namespaceCreateFailingClient struct {
+	client.Client
+	err error
+}
+
+func (c *namespaceCreateFailingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*corev1.Namespace); ok {
+		return c.err
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func step(err error) StepFn {
+	return func(_ context.Context, _ *envtest.Environment, _ client.Client) error { return err }
+}
+
+func TestRunFeatures(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	cases := map[string]struct {
+		features   []Feature
+		wantPassed []bool
+		wantErr    bool
+		wantSteps  []int // total steps recorded per feature
+	}{
+		"AllStepsPass": {
+			features: []Feature{
+				{
+					Name:     "cool-feature",
+					Setup:    []StepFn{step(nil)},
+					Assess:   []StepFn{step(nil)},
+					Teardown: []StepFn{step(nil)},
+				},
+			},
+			wantPassed: []bool{true},
+			wantSteps:  []int{3},
+		},
+		"SetupFailureSkipsAssessButRunsTeardown": {
+			features: []Feature{
+				{
+					Name:     "broken-feature",
+					Setup:    []StepFn{step(errBoom)},
+					Assess:   []StepFn{step(nil)},
+					Teardown: []StepFn{step(nil)},
+				},
+			},
+			wantPassed: []bool{false},
+			wantErr:    true,
+			// Setup + Teardown ran, Assess was skipped.
+			wantSteps: []int{2},
+		},
+		"TeardownFailureFailsFeatureEvenIfAssessPassed": {
+			features: []Feature{
+				{
+					Name:     "leaky-feature",
+					Setup:    []StepFn{step(nil)},
+					Assess:   []StepFn{step(nil)},
+					Teardown: []StepFn{step(errBoom)},
+				},
+			},
+			wantPassed: []bool{false},
+			wantErr:    true,
+			wantSteps:  []int{3},
+		},
+		"MultipleFeaturesAggregateAcrossAll": {
+			features: []Feature{
+				{Name: "a", Setup: []StepFn{step(nil)}},
+				{Name: "b", Setup: []StepFn{step(errBoom)}},
+			},
+			wantPassed: []bool{true, false},
+			wantErr:    true,
+			wantSteps:  []int{1, 1},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := newTestManager()
+
+			reports, err := m.RunFeatures(context.Background(), tc.features...)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("RunFeatures(...): wantErr %t, got error: %v", tc.wantErr, err)
+			}
+			if len(reports) != len(tc.features) {
+				t.Fatalf("RunFeatures(...): want %d reports, got %d", len(tc.features), len(reports))
+			}
+
+			for i, r := range reports {
+				if r.Passed != tc.wantPassed[i] {
+					t.Errorf("reports[%d].Passed: want %t, got %t", i, tc.wantPassed[i], r.Passed)
+				}
+				if len(r.Steps) != tc.wantSteps[i] {
+					t.Errorf("reports[%d].Steps: want %d steps, got %d", i, tc.wantSteps[i], len(r.Steps))
+				}
+			}
+		})
+	}
+}
+
+func TestRunFeaturesNamespaceFailureContinuesToNextFeature(t *testing.T) {
+	errBoom := errors.New("boom")
+	teardownRan := false
+
+	m := newTestManager()
+	m.client = &namespaceCreateFailingClient{Client: m.client, err: errBoom}
+
+	features := []Feature{
+		*NewFeature("no-namespace", WithNamespace("broken")),
+		{Name: "no-namespace", Setup: []StepFn{step(nil)}},
+	}
+	features[0].Teardown = []StepFn{step(nil)}
+	features[1].Teardown = []StepFn{
+		func(context.Context, *envtest.Environment, client.Client) error {
+			teardownRan = true
+			return nil
+		},
+	}
+
+	reports, err := m.RunFeatures(context.Background(), features...)
+	if err == nil {
+		t.Fatal("RunFeatures(...): expected an error, got none")
+	}
+	if len(reports) != 2 {
+		t.Fatalf("RunFeatures(...): want 2 reports, got %d", len(reports))
+	}
+
+	if reports[0].Passed {
+		t.Error("reports[0].Passed: want false, got true")
+	}
+	if len(reports[0].Steps) != 2 {
+		t.Errorf("reports[0].Steps: want 2 (failed Setup + Teardown), got %d", len(reports[0].Steps))
+	}
+	if reports[0].Steps[0].Stage != "Setup" || reports[0].Steps[0].Error == "" {
+		t.Errorf("reports[0].Steps[0]: want a failed Setup step recording the namespace error, got %+v", reports[0].Steps[0])
+	}
+
+	if !reports[1].Passed {
+		t.Error("reports[1].Passed: want true, got false - the second feature should still have run")
+	}
+	if !teardownRan {
+		t.Error("the second feature's Teardown never ran")
+	}
+}
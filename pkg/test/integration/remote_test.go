@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The Crossplane Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package integration
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	content := []byte("a CRD manifest")
+	sum := sha256.Sum256(content)
+
+	cases := map[string]struct {
+		content []byte
+		sum     string
+		wantErr bool
+	}{
+		"NoChecksumConfigured": {
+			content: content,
+			sum:     "",
+		},
+		"ChecksumMatches": {
+			content: content,
+			sum:     hex.EncodeToString(sum[:]),
+		},
+		"ChecksumMismatch": {
+			content: content,
+			sum:     hex.EncodeToString(sha256.New().Sum(nil)),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := verifyChecksum(tc.content, tc.sum)
+			if tc.wantErr != (err != nil) {
+				t.Errorf("verifyChecksum(...): wantErr %t, got error: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSubdirFor(t *testing.T) {
+	a := subdirFor("https://example.org/a.yaml")
+	b := subdirFor("https://example.org/b.yaml")
+
+	if a == b {
+		t.Errorf("subdirFor(...): distinct URLs produced the same subdirectory %q", a)
+	}
+	if a != subdirFor("https://example.org/a.yaml") {
+		t.Errorf("subdirFor(...): the same URL produced different subdirectories")
+	}
+}
+
+func TestExtractTarball(t *testing.T) {
+	files := map[string]string{
+		"a.yaml": "kind: CustomResourceDefinition\n",
+		"b.yaml": "kind: CustomResourceDefinition\n",
+	}
+
+	// extractTarball is only ever called with the output of a layer's
+	// Uncompressed(), which is already a plain (non-gzipped) tar stream.
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(content))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(...): %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Write(...): %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tw.Close(): %v", err)
+	}
+
+	dst, err := ioutil.TempDir("", "extract-tarball-")
+	if err != nil {
+		t.Fatalf("TempDir(...): %v", err)
+	}
+	defer os.RemoveAll(dst) //nolint:errcheck
+
+	if err := extractTarball(buf.Bytes(), dst); err != nil {
+		t.Fatalf("extractTarball(...): unexpected error: %v", err)
+	}
+
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dst, name))
+		if err != nil {
+			t.Fatalf("ReadFile(%q): %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("extractTarball(...): %q: want %q, got %q", name, want, string(got))
+		}
+	}
+}
+
+func TestExtractTarballInvalidTar(t *testing.T) {
+	dst, err := ioutil.TempDir("", "extract-tarball-")
+	if err != nil {
+		t.Fatalf("TempDir(...): %v", err)
+	}
+	defer os.RemoveAll(dst) //nolint:errcheck
+
+	if err := extractTarball([]byte("not a tarball"), dst); err == nil {
+		t.Error("extractTarball(...): expected an error for non-tar content, got none")
+	}
+}
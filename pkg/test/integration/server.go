@@ -17,12 +17,16 @@ limitations under the License.
 package integration
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"time"
 
 	"github.com/pkg/errors"
-	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	// Allow auth to cloud providers
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -34,10 +38,11 @@ import (
 )
 
 const (
-	syncPeriod   = "30s"
-	errCleanup   = "failure in default cleanup"
-	errGetRemote = "unable to download CRDs from remote location"
-	remotePath   = "./tmp-test"
+	syncPeriod      = "30s"
+	errCleanup      = "failure in default cleanup"
+	errGetRemote    = "unable to download CRDs from remote location"
+	errTransformCRD = "CRD transformer failed"
+	errMakeTempDir  = "cannot create temporary directory for remote CRDs"
 )
 
 // OperationFn is a function that uses a Kubernetes client to perform and
@@ -47,10 +52,52 @@ type OperationFn func(*envtest.Environment, client.Client) error
 // Config is a set of configuration values for setup.
 type Config struct {
 	RemoteCRDPaths    []string
+	RemoteCRDs        []RemoteCRD
 	CRDDirectoryPaths []string
 	Builder           OperationFn
 	Cleaners          []OperationFn
 	ManagerOptions    manager.Options
+
+	// CleanUpInstalledCRDs, if true, registers a Cleaner that deletes only
+	// the CRDs this Manager actually installed, rather than re-reading
+	// CRDDirectoryPaths at cleanup time.
+	CleanUpInstalledCRDs bool
+
+	// CRDEstablishmentPollInterval and CRDEstablishmentTimeout control how
+	// long New waits for installed CRDs to report the Established
+	// condition before invoking Builder.
+	CRDEstablishmentPollInterval time.Duration
+	CRDEstablishmentTimeout      time.Duration
+
+	// BinaryAssetsDirectory is forwarded to envtest.Environment, and should
+	// point to kube-apiserver, etcd and kubectl binaries such as those
+	// managed by setup-envtest. If empty, envtest falls back to its own
+	// discovery (e.g. KUBEBUILDER_ASSETS).
+	BinaryAssetsDirectory string
+
+	// KubeAPIServerFlags are set on the envtest-managed kube-apiserver's
+	// argument list, overriding any default envtest sets for the same flag.
+	KubeAPIServerFlags map[string]string
+
+	// SecureServing controls whether the envtest-managed kube-apiserver
+	// serves securely, as modern (1.20+) versions of envtest do by default.
+	// Setting this to false only clears secure-port; kube-apiserver 1.20+
+	// has no insecure serving mode to fall back to, so New no longer tries
+	// to force one on. Disabling this is only useful with a pre-1.20
+	// kube-apiserver binary that still honours --insecure-port, which you
+	// must set yourself via KubeAPIServerFlags.
+	SecureServing bool
+
+	// CRDFilter, if set, is called for every CRD discovered in
+	// CRDDirectoryPaths and RemoteCRDPaths after CRDTransformer has run. CRDs
+	// for which it returns false are not installed.
+	CRDFilter func(*apiextensionsv1.CustomResourceDefinition) bool
+
+	// CRDTransformer, if set, is called for every CRD discovered in
+	// CRDDirectoryPaths and RemoteCRDPaths before CRDFilter runs, and may
+	// mutate it in place - e.g. to inject a conversion webhook CA bundle, or
+	// rewrite its group for test isolation.
+	CRDTransformer func(*apiextensionsv1.CustomResourceDefinition) error
 }
 
 // NewBuilder returns a new no-op Builder
@@ -68,7 +115,7 @@ func NewCRDCleaner() OperationFn {
 		if err != nil {
 			return errors.Wrap(err, errCleanup)
 		}
-		var crds []*apiextensionsv1beta1.CustomResourceDefinition
+		var crds []*apiextensionsv1.CustomResourceDefinition
 		for _, path := range e.CRDDirectoryPaths {
 			crd, err := readCRDs(path)
 			if err != nil {
@@ -78,7 +125,7 @@ func NewCRDCleaner() OperationFn {
 		}
 
 		for _, crd := range crds {
-			if err := cs.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(crd.Name, nil); err != nil {
+			if err := cs.ApiextensionsV1().CustomResourceDefinitions().Delete(context.Background(), crd.Name, metav1.DeleteOptions{}); err != nil {
 				return errors.Wrap(err, errCleanup)
 			}
 		}
@@ -86,11 +133,25 @@ func NewCRDCleaner() OperationFn {
 	}
 }
 
-// NewRemoteDirCleaner cleans up the default directory where remote CRDs were
-// downloaded.
-func NewRemoteDirCleaner() OperationFn {
+// cleanInstalledCRDs returns a Cleaner that deletes exactly the supplied
+// CRDs, rather than re-reading CRDDirectoryPaths from disk. This is the
+// Cleaner registered by WithCleanUpInstalledCRDs, since by the time cleanup
+// runs the directories a Manager was configured with may have changed or be
+// gone entirely (e.g. a temporary remote download directory).
+func cleanInstalledCRDs(installed []*apiextensionsv1.CustomResourceDefinition) OperationFn {
 	return func(e *envtest.Environment, c client.Client) error {
-		return os.RemoveAll(remotePath)
+		cs, err := clientset.NewForConfig(e.Config)
+		if err != nil {
+			return errors.Wrap(err, errCleanup)
+		}
+
+		for _, crd := range installed {
+			err := cs.ApiextensionsV1().CustomResourceDefinitions().Delete(context.Background(), crd.Name, metav1.DeleteOptions{})
+			if err != nil && !kerrors.IsNotFound(err) {
+				return errors.Wrap(err, errCleanup)
+			}
+		}
+		return nil
 	}
 }
 
@@ -118,13 +179,22 @@ func WithCRDDirectoryPaths(crds ...string) Option {
 	}
 }
 
-// WithRemoteCRDPaths sets custom remote CRD locations for a Config.
+// WithRemoteCRDPaths sets custom remote CRD locations for a Config. Prefer
+// WithRemoteCRDs, which also supports checksum verification.
 func WithRemoteCRDPaths(urls ...string) Option {
 	return func(c *Config) {
 		c.RemoteCRDPaths = urls
 	}
 }
 
+// WithRemoteCRDs sets custom remote CRD sources for a Config, each
+// optionally verified against a sha256 checksum once downloaded.
+func WithRemoteCRDs(remotes ...RemoteCRD) Option {
+	return func(c *Config) {
+		c.RemoteCRDs = remotes
+	}
+}
+
 // WithManagerOptions sets custom options for the manager configured by
 // Config.
 func WithManagerOptions(m manager.Options) Option {
@@ -133,6 +203,70 @@ func WithManagerOptions(m manager.Options) Option {
 	}
 }
 
+// WithCleanUpInstalledCRDs configures whether New registers a Cleaner that
+// deletes only the CRDs this Manager actually installed. It complements,
+// rather than replaces, the default Cleaners.
+func WithCleanUpInstalledCRDs(cleanUp bool) Option {
+	return func(c *Config) {
+		c.CleanUpInstalledCRDs = cleanUp
+	}
+}
+
+// WithCRDEstablishmentTimeout overrides how long New waits, and how often it
+// polls, for installed CRDs to report the Established condition before
+// invoking Builder.
+func WithCRDEstablishmentTimeout(pollInterval, timeout time.Duration) Option {
+	return func(c *Config) {
+		c.CRDEstablishmentPollInterval = pollInterval
+		c.CRDEstablishmentTimeout = timeout
+	}
+}
+
+// WithBinaryAssetsDirectory points envtest at a directory of pre-fetched
+// kube-apiserver, etcd and kubectl binaries, such as those managed by
+// setup-envtest, instead of relying on KUBEBUILDER_ASSETS.
+func WithBinaryAssetsDirectory(dir string) Option {
+	return func(c *Config) {
+		c.BinaryAssetsDirectory = dir
+	}
+}
+
+// WithKubeAPIServerFlags sets additional flags on the envtest-managed
+// kube-apiserver, overriding any default envtest sets for the same flag.
+func WithKubeAPIServerFlags(flags map[string]string) Option {
+	return func(c *Config) {
+		c.KubeAPIServerFlags = flags
+	}
+}
+
+// WithSecureServing controls whether the envtest-managed kube-apiserver
+// serves securely. Disabling it only clears secure-port; kube-apiserver
+// 1.20+ removed --insecure-port entirely, so this is only useful with an
+// older binary configured to serve insecurely via WithKubeAPIServerFlags.
+func WithSecureServing(secure bool) Option {
+	return func(c *Config) {
+		c.SecureServing = secure
+	}
+}
+
+// WithCRDFilter drops CRDs for which the supplied function returns false
+// before they're installed, e.g. to only install CRDs for a feature that's
+// enabled.
+func WithCRDFilter(filter func(*apiextensionsv1.CustomResourceDefinition) bool) Option {
+	return func(c *Config) {
+		c.CRDFilter = filter
+	}
+}
+
+// WithCRDTransformer mutates every discovered CRD before it's installed,
+// e.g. to inject a conversion webhook CA bundle or rewrite its group for
+// test isolation.
+func WithCRDTransformer(transform func(*apiextensionsv1.CustomResourceDefinition) error) Option {
+	return func(c *Config) {
+		c.CRDTransformer = transform
+	}
+}
+
 func defaultConfig() *Config {
 	t, err := time.ParseDuration(syncPeriod)
 	if err != nil {
@@ -140,21 +274,27 @@ func defaultConfig() *Config {
 	}
 
 	return &Config{
-		RemoteCRDPaths:    []string{},
-		CRDDirectoryPaths: []string{},
-		Builder:           NewBuilder(),
-		Cleaners:          []OperationFn{NewCRDCleaner()},
-		ManagerOptions:    manager.Options{SyncPeriod: &t},
+		RemoteCRDPaths:               []string{},
+		CRDDirectoryPaths:            []string{},
+		Builder:                      NewBuilder(),
+		Cleaners:                     []OperationFn{NewCRDCleaner()},
+		ManagerOptions:               manager.Options{SyncPeriod: &t},
+		CRDEstablishmentPollInterval: defaultCRDEstablishPollInterval,
+		CRDEstablishmentTimeout:      defaultCRDEstablishTimeout,
+		SecureServing:                true,
 	}
 }
 
 // Manager wraps a controller-runtime manager with additional functionality.
 type Manager struct {
 	manager.Manager
-	stop   chan struct{}
-	env    *envtest.Environment
-	client client.Client
-	c      *Config
+	stop        chan struct{}
+	env         *envtest.Environment
+	client      client.Client
+	config      *rest.Config
+	remoteDir   string
+	renderedDir string
+	c           *Config
 }
 
 // New creates a new Manager.
@@ -169,25 +309,89 @@ func New(cfg *rest.Config, o ...Option) (*Manager, error) {
 		op(c)
 	}
 
-	for _, url := range c.RemoteCRDPaths {
-		if err := downloadPath(url, remotePath); err != nil {
+	remoteDir, err := ioutil.TempDir("", "integration-remote-crds-")
+	if err != nil {
+		return nil, errors.Wrap(err, errMakeTempDir)
+	}
+
+	remotes := make([]RemoteCRD, 0, len(c.RemoteCRDs)+len(c.RemoteCRDPaths))
+	remotes = append(remotes, c.RemoteCRDs...)
+	for _, u := range c.RemoteCRDPaths {
+		remotes = append(remotes, RemoteCRD{URL: u})
+	}
+
+	for _, rc := range remotes {
+		path, err := downloadPath(rc, remoteDir)
+		if err != nil {
 			return nil, errors.Wrap(err, errGetRemote)
 		}
+		c.CRDDirectoryPaths = append(c.CRDDirectoryPaths, path)
+	}
+
+	var discovered []*apiextensionsv1.CustomResourceDefinition
+	for _, path := range c.CRDDirectoryPaths {
+		crds, err := readCRDs(path)
+		if err != nil {
+			return nil, err
+		}
+		discovered = append(discovered, crds...)
 	}
 
-	c.CRDDirectoryPaths = append(c.CRDDirectoryPaths, remotePath)
+	installed := make([]*apiextensionsv1.CustomResourceDefinition, 0, len(discovered))
+	for _, crd := range discovered {
+		if c.CRDTransformer != nil {
+			if err := c.CRDTransformer(crd); err != nil {
+				return nil, errors.Wrap(err, errTransformCRD)
+			}
+		}
+		if c.CRDFilter != nil && !c.CRDFilter(crd) {
+			continue
+		}
+		installed = append(installed, crd)
+	}
+
+	renderedCRDPath, err := renderCRDs(installed)
+	if err != nil {
+		return nil, err
+	}
 
 	e := &envtest.Environment{
-		CRDDirectoryPaths:  c.CRDDirectoryPaths,
-		Config:             cfg,
-		UseExistingCluster: &useExisting,
+		CRDDirectoryPaths:     []string{renderedCRDPath},
+		Config:                cfg,
+		UseExistingCluster:    &useExisting,
+		BinaryAssetsDirectory: c.BinaryAssetsDirectory,
+	}
+
+	args := e.ControlPlane.GetAPIServer().Configure()
+	for flag, value := range c.KubeAPIServerFlags {
+		args.Set(flag, value)
+	}
+	if !c.SecureServing {
+		// kube-apiserver 1.20+ removed --insecure-port, so there's no
+		// replacement serving mode to fall back to here. Callers relying on
+		// a pre-1.20 binary can still serve insecurely by setting
+		// --insecure-port themselves via KubeAPIServerFlags.
+		args.Set("secure-port", "0")
+	}
+
+	cfg, err = e.Start()
+	if err != nil {
+		return nil, err
 	}
 
-	cfg, err := e.Start()
+	cs, err := clientset.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := waitForCRDEstablishment(cs, installed, c.CRDEstablishmentPollInterval, c.CRDEstablishmentTimeout); err != nil {
+		return nil, err
+	}
+
+	if c.CleanUpInstalledCRDs {
+		c.Cleaners = append(c.Cleaners, cleanInstalledCRDs(installed))
+	}
+
 	client, err := client.New(cfg, client.Options{})
 	if err != nil {
 		return nil, err
@@ -203,7 +407,7 @@ func New(cfg *rest.Config, o ...Option) (*Manager, error) {
 	}
 
 	stop := make(chan struct{})
-	return &Manager{mgr, stop, e, client, c}, nil
+	return &Manager{mgr, stop, e, client, cfg, remoteDir, renderedCRDPath, c}, nil
 }
 
 // Run starts a controller-runtime manager with a signal channel.
@@ -220,6 +424,12 @@ func (m *Manager) GetClient() client.Client {
 	return m.client
 }
 
+// GetConfig returns the authenticated rest.Config used to connect to the
+// running API server, e.g. to construct additional impersonating clients.
+func (m *Manager) GetConfig() *rest.Config {
+	return m.config
+}
+
 // Cleanup runs the supplied cleanup or defaults to deleting all CRDs.
 func (m *Manager) Cleanup() error {
 	close(m.stop)
@@ -229,5 +439,13 @@ func (m *Manager) Cleanup() error {
 		}
 	}
 
+	if err := os.RemoveAll(m.remoteDir); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(m.renderedDir); err != nil {
+		return err
+	}
+
 	return m.env.Stop()
 }